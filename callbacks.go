@@ -0,0 +1,43 @@
+package heartbeat
+
+import "sync"
+
+// callbackQueue runs callbacks (OnStateChange, OnSuccess, OnRecovery, and OnPersistentFailure)
+// one at a time, in the order they're queued, on a goroutine which Stop doesn't wait for. Callbacks
+// may therefore call any of the Heartbeat's methods, including Stop, without deadlocking.
+// The goroutine runs only while callbacks are queued, so the queue needn't be stopped.
+type callbackQueue struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool
+}
+
+// enqueue queues fn to be called after all previously queued callbacks have returned.
+func (q *callbackQueue) enqueue(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue = append(q.queue, fn)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+// run calls queued callbacks until the queue is empty.
+func (q *callbackQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.queue) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		fn := q.queue[0]
+		q.queue[0] = nil
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+
+		fn()
+	}
+}
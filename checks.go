@@ -0,0 +1,137 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCheckTimeout = time.Second
+
+// Check is a health check run on each request to the heartbeat HTTP server.
+type Check struct {
+	// Name identifies the check in errors. Required.
+	Name string
+	// Check reports whether the check passes by returning nil. It should return promptly
+	// once ctx is done. A panic in Check is treated as a failure. Required.
+	Check func(ctx context.Context) error
+	// Optional, if true, causes the check's failure not to affect the server's response.
+	Optional bool
+	// CacheTTL, if positive, is how long the check's result is reused before the check is run again,
+	// which limits how often expensive checks run when the server is probed frequently. Optional;
+	// by default, the check runs on every request.
+	CacheTTL time.Duration
+}
+
+// checkResult is a cached result of a Check.
+type checkResult struct {
+	err error
+	at  time.Time
+}
+
+// CheckStatus reports the result of a Check in a verbose health response; see Config.VerboseHealth.
+type CheckStatus struct {
+	// Name is the check's name.
+	Name string `json:"name"`
+	// OK indicates whether the check passed.
+	OK bool `json:"ok"`
+	// Optional indicates that the check's failure doesn't affect the server's response.
+	Optional bool `json:"optional,omitempty"`
+	// Error describes why the check failed. It is omitted if the check passed.
+	Error string `json:"error,omitempty"`
+}
+
+// runChecks runs all Checks concurrently, each with a context that is canceled after CheckTimeout,
+// and waits for them to complete or time out. It returns each check's error (nil if it passed),
+// in the order of Checks.
+func (h *heartbeat) runChecks(ctx context.Context) []error {
+	if len(h.checks) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(h.checks))
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			errs[i] = h.runCheckCached(ctx, i, c)
+		}(i, c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// failedChecksReason describes the failed required checks among errs, as returned by runChecks.
+// It returns "" if all required checks passed.
+func (h *heartbeat) failedChecksReason(errs []error) string {
+	var failed []string
+	for i, err := range errs {
+		if err != nil && !h.checks[i].Optional {
+			failed = append(failed, err.Error())
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// checkStatuses describes each check's result in errs, as returned by runChecks.
+func (h *heartbeat) checkStatuses(errs []error) []CheckStatus {
+	statuses := make([]CheckStatus, len(errs))
+	for i, err := range errs {
+		statuses[i] = CheckStatus{Name: h.checks[i].Name, OK: err == nil, Optional: h.checks[i].Optional}
+		if err != nil {
+			statuses[i].Error = err.Error()
+		}
+	}
+	return statuses
+}
+
+// runCheckCached returns the cached result of the i'th check if it's within the check's CacheTTL,
+// or otherwise runs the check and caches its result.
+func (h *heartbeat) runCheckCached(ctx context.Context, i int, c Check) error {
+	if c.CacheTTL <= 0 {
+		return h.runCheck(ctx, c)
+	}
+
+	h.mu.Lock()
+	cached := h.checkResults[i]
+	h.mu.Unlock()
+	if !cached.at.IsZero() && time.Since(cached.at) < c.CacheTTL {
+		return cached.err
+	}
+
+	err := h.runCheck(ctx, c)
+	h.mu.Lock()
+	h.checkResults[i] = checkResult{err: err, at: time.Now()}
+	h.mu.Unlock()
+	return err
+}
+
+// runCheck runs the given check, giving up after CheckTimeout even if the check doesn't
+// respect its context's cancellation.
+func (h *heartbeat) runCheck(ctx context.Context, c Check) error {
+	ctx, cancel := context.WithTimeout(ctx, h.checkTimeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				result <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		result <- c.Check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("check '%s' failed: %w", c.Name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("check '%s' failed: %w", c.Name, ctx.Err())
+	}
+}
@@ -0,0 +1,158 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+)
+
+// ErrStopped is returned by SendNow and SendNowTimeout when called after Stop.
+var ErrStopped = errors.New("heartbeat is stopped")
+
+// ErrorKind classifies the errors passed to OnError.
+// Heartbeats skipped because the liveness threshold has lapsed are not errors.
+type ErrorKind int
+
+const (
+	// ErrorKindRequest indicates that a heartbeat request could not be made or completed,
+	// e.g. due to a network error other than those classified as ErrorKindDNS or ErrorKindConnection.
+	ErrorKindRequest ErrorKind = iota
+	// ErrorKindTimeout indicates that a heartbeat request did not complete within the HTTP timeout.
+	ErrorKindTimeout
+	// ErrorKindStatus indicates that a heartbeat request received an unsuccessful HTTP status.
+	ErrorKindStatus
+	// ErrorKindResponse indicates that a heartbeat response's body indicated failure.
+	ErrorKindResponse
+	// ErrorKindServer indicates that the heartbeat HTTP server failed.
+	ErrorKindServer
+	// ErrorKindClockSkew indicates that Alive was called with a time further in the future than
+	// MaxAliveSkew allows; the current time was used instead.
+	ErrorKindClockSkew
+	// ErrorKindSlow indicates that a heartbeat succeeded, but took longer than LatencyBudget.
+	// It is a warning: the heartbeat is not counted as a failure.
+	ErrorKindSlow
+	// ErrorKindDNS indicates that a heartbeat URL's host couldn't be resolved, which often
+	// indicates misconfiguration (if the host doesn't exist) or a DNS outage.
+	ErrorKindDNS
+	// ErrorKindConnection indicates that a connection to a heartbeat URL's host couldn't be
+	// established (e.g. it was refused, or the host or network is unreachable), which often
+	// indicates that the monitor is down or unreachable.
+	ErrorKindConnection
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindRequest:
+		return "request"
+	case ErrorKindTimeout:
+		return "timeout"
+	case ErrorKindStatus:
+		return "status"
+	case ErrorKindResponse:
+		return "response"
+	case ErrorKindServer:
+		return "server"
+	case ErrorKindClockSkew:
+		return "clock skew"
+	case ErrorKindSlow:
+		return "slow"
+	case ErrorKindDNS:
+		return "dns"
+	case ErrorKindConnection:
+		return "connection"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+}
+
+// Error describes a failure to send a heartbeat or to run the heartbeat HTTP server,
+// an invalid Alive call, or a slow heartbeat.
+// Errors passed to OnError are of type *Error, as are the errors returned (possibly joined) by ServerErr().
+type Error struct {
+	// Kind classifies the error.
+	Kind ErrorKind
+	// URL is the heartbeat URL the failed heartbeat was sent to. It is empty for ErrorKindServer
+	// and ErrorKindClockSkew errors.
+	URL string
+	// RequestID is the heartbeat request's ID, if GenerateRequestID is set.
+	RequestID string
+	// StatusCode is the HTTP status code of the heartbeat response, if one was received.
+	StatusCode int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == ErrorKindServer || e.Kind == ErrorKindClockSkew {
+		return e.Err.Error()
+	}
+	outcome := "failed"
+	if e.Kind == ErrorKindSlow {
+		outcome = "was slow"
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("heartbeat to '%s' (request ID %s) %s: %v", e.URL, e.RequestID, outcome, e.Err)
+	}
+	return fmt.Sprintf("heartbeat to '%s' %s: %v", e.URL, outcome, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// requestErrorKind classifies an error returned while making a heartbeat request.
+func requestErrorKind(err error) ErrorKind {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorKindTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorKindDNS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorKindConnection
+	}
+	return ErrorKindRequest
+}
+
+// DefaultRetryable is the default Config.RetryableFunc. It reports whether err is a heartbeat
+// failure which may succeed if retried: a timeout, a connection failure, a temporary DNS failure,
+// another network error (e.g. a reset connection or truncated response), or a 5xx response. Other
+// failures, such as 4xx responses, DNS lookups of hosts which don't exist, TLS certificate errors,
+// and refused redirects, are not retried.
+func DefaultRetryable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Kind {
+	case ErrorKindTimeout, ErrorKindConnection:
+		return true
+	case ErrorKindDNS:
+		var dnsErr *net.DNSError
+		return errors.As(e.Err, &dnsErr) && !dnsErr.IsNotFound
+	case ErrorKindRequest:
+		return isTransportError(e.Err)
+	case ErrorKindStatus:
+		return e.StatusCode >= 500 && e.StatusCode <= 599
+	default:
+		return false
+	}
+}
+
+// isTransportError reports whether err, returned while making a heartbeat request, was caused by the
+// network rather than by the request or its configuration. Note that *url.Error, which wraps every
+// error returned by http.Client.Do, implements net.Error, so it can't be used to tell them apart.
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,39 @@
+package heartbeat
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestDefaultRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &Error{Kind: ErrorKindTimeout}, true},
+		{"connection", &Error{Kind: ErrorKindConnection}, true},
+		{"connection reset", &Error{Kind: ErrorKindRequest, Err: urlErr(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")})}, true},
+		{"truncated response", &Error{Kind: ErrorKindRequest, Err: urlErr(io.ErrUnexpectedEOF)}, true},
+		{"refused redirect", &Error{Kind: ErrorKindRequest, Err: urlErr(errors.New("refusing redirect to different host 'example.net'"))}, false},
+		{"too many redirects", &Error{Kind: ErrorKindRequest, Err: urlErr(errors.New("stopped after 10 redirects"))}, false},
+		{"DNS not found", &Error{Kind: ErrorKindDNS, Err: &net.DNSError{IsNotFound: true}}, false},
+		{"DNS temporary", &Error{Kind: ErrorKindDNS, Err: &net.DNSError{IsTemporary: true}}, true},
+		{"5xx", &Error{Kind: ErrorKindStatus, StatusCode: 503}, true},
+		{"4xx", &Error{Kind: ErrorKindStatus, StatusCode: 404}, false},
+		{"not an *Error", errors.New("failed"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRetryable(tt.err); got != tt.want {
+				t.Errorf("DefaultRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
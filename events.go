@@ -0,0 +1,83 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// eventBufferSize is the number of heartbeat events buffered for EventWriter. Events are dropped
+// while the buffer is full, so that a slow EventWriter never delays heartbeats.
+const eventBufferSize = 256
+
+// event is a heartbeat's outcome, as written to EventWriter.
+type event struct {
+	Time       time.Time `json:"time"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// recordEvent queues an event describing a heartbeat's outcome for EventWriter, if it's set.
+func (h *heartbeat) recordEvent(url string, success Success, err *Error) {
+	if h.eventWriter == nil {
+		return
+	}
+
+	e := event{Time: time.Now(), URL: redactURL(url), StatusCode: success.StatusCode, Success: err == nil}
+	if err != nil {
+		e.StatusCode = err.StatusCode
+		e.Error = err.Err.Error()
+	}
+	select {
+	case h.events <- e:
+	default:
+		if h.logger != nil {
+			h.logger.Warn("dropping heartbeat event because the event writer is falling behind")
+		}
+	}
+}
+
+// startEventWriterLocked starts writing queued events to EventWriter, if it's set, until
+// stopEventWriter is called.
+func (h *heartbeat) startEventWriterLocked() {
+	if h.eventWriter == nil {
+		return
+	}
+
+	h.eventsDone = make(chan struct{})
+	go func() {
+		defer close(h.eventsDone)
+		enc := json.NewEncoder(h.eventWriter)
+		write := func(e event) {
+			if err := enc.Encode(e); err != nil && h.logger != nil {
+				h.logger.Warn("failed to write heartbeat event", "error", err)
+			}
+		}
+		for {
+			select {
+			case e := <-h.events:
+				write(e)
+			case <-h.eventsStop:
+				for {
+					select {
+					case e := <-h.events:
+						write(e)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// stopEventWriter writes any queued events, then stops the event writer if it was started.
+// eventsDone must be the event writer's done channel, or nil if it wasn't started.
+func (h *heartbeat) stopEventWriter(eventsDone chan struct{}) {
+	if eventsDone == nil {
+		return
+	}
+	close(h.eventsStop)
+	<-eventsDone
+}
@@ -1,3 +1,5 @@
 module github.com/cdzombak/heartbeat
 
 go 1.21.3
+
+require golang.org/x/net v0.35.0
@@ -0,0 +1,414 @@
+package heartbeat
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newRecordingServer returns a server which responds to each request with 200 OK,
+// and a channel on which the time each request was received is sent.
+func newRecordingServer(t *testing.T) (*httptest.Server, <-chan time.Time) {
+	t.Helper()
+	received := make(chan time.Time, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- time.Now()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+// nextRequest waits for the next request recorded by a server from newRecordingServer.
+func nextRequest(t *testing.T, received <-chan time.Time) time.Time {
+	t.Helper()
+	select {
+	case at := <-received:
+		return at
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a heartbeat")
+		return time.Time{}
+	}
+}
+
+// startForSetInterval creates and starts an always-alive Heartbeat sending to srv every interval.
+func startForSetInterval(t *testing.T, srv *httptest.Server, interval time.Duration) Heartbeat {
+	t.Helper()
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: interval,
+		LivenessThreshold: time.Hour,
+		HTTPTimeout:       50 * time.Millisecond,
+		HeartbeatURL:      srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb.Alive(time.Now())
+	if err := hb.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = hb.Stop() })
+	return hb
+}
+
+func TestSetIntervalShorten(t *testing.T) {
+	srv, received := newRecordingServer(t)
+	hb := startForSetInterval(t, srv, 400*time.Millisecond)
+
+	first := nextRequest(t, received)
+	if err := hb.SetInterval(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	second := nextRequest(t, received)
+	third := nextRequest(t, received)
+
+	// The next heartbeat follows the previous one by the new interval: it neither waits
+	// for the old interval nor is sent twice.
+	if gap := second.Sub(first); gap < 70*time.Millisecond || gap > 250*time.Millisecond {
+		t.Errorf("first heartbeat after SetInterval came %s after the previous one; want about 100ms", gap)
+	}
+	if gap := third.Sub(second); gap < 70*time.Millisecond || gap > 250*time.Millisecond {
+		t.Errorf("heartbeats after SetInterval came %s apart; want about 100ms", gap)
+	}
+}
+
+func TestSetIntervalLengthen(t *testing.T) {
+	srv, received := newRecordingServer(t)
+	hb := startForSetInterval(t, srv, 100*time.Millisecond)
+
+	first := nextRequest(t, received)
+	if err := hb.SetInterval(400 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	second := nextRequest(t, received)
+	third := nextRequest(t, received)
+
+	if gap := second.Sub(first); gap < 350*time.Millisecond || gap > 600*time.Millisecond {
+		t.Errorf("first heartbeat after SetInterval came %s after the previous one; want about 400ms", gap)
+	}
+	if gap := third.Sub(second); gap < 350*time.Millisecond || gap > 600*time.Millisecond {
+		t.Errorf("heartbeats after SetInterval came %s apart; want about 400ms", gap)
+	}
+}
+
+func TestSetIntervalEffectiveConfig(t *testing.T) {
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 200 * time.Millisecond,
+		LivenessThreshold: time.Hour,
+		HTTPTimeout:       50 * time.Millisecond,
+		Targets: []HeartbeatTarget{
+			{URL: "https://example.com/default"},
+			{URL: "https://example.com/own", Interval: time.Second},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hb.SetInterval(300 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := hb.EffectiveConfig()
+	if cfg.HeartbeatInterval != 300*time.Millisecond {
+		t.Errorf("HeartbeatInterval = %s, want 300ms", cfg.HeartbeatInterval)
+	}
+	if got := cfg.Targets[0].Interval; got != 300*time.Millisecond {
+		t.Errorf("defaulted target's Interval = %s, want 300ms", got)
+	}
+	if got := cfg.Targets[1].Interval; got != time.Second {
+		t.Errorf("target's own Interval = %s, want 1s", got)
+	}
+}
+
+func TestSetIntervalDefaultedHTTPTimeout(t *testing.T) {
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 5 * time.Minute,
+		LivenessThreshold: time.Hour,
+		Targets: []HeartbeatTarget{
+			{URL: "https://example.com/default"},
+			{URL: "https://example.com/own", Interval: 10 * time.Minute},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default timeout follows the new shortest interval, whether it's shorter or longer.
+	for _, tt := range []struct{ interval, wantTimeout time.Duration }{
+		{time.Minute, 59 * time.Second},
+		{20 * time.Minute, 10*time.Minute - time.Second},
+	} {
+		if err := hb.SetInterval(tt.interval); err != nil {
+			t.Fatalf("SetInterval(%s) = %v; want nil", tt.interval, err)
+		}
+		if got := hb.EffectiveHTTPTimeout(); got != tt.wantTimeout {
+			t.Errorf("after SetInterval(%s), EffectiveHTTPTimeout() = %s; want %s", tt.interval, got, tt.wantTimeout)
+		}
+		if got := hb.EffectiveConfig().HTTPTimeout; got != tt.wantTimeout {
+			t.Errorf("after SetInterval(%s), EffectiveConfig().HTTPTimeout = %s; want %s", tt.interval, got, tt.wantTimeout)
+		}
+	}
+}
+
+func TestSetIntervalExplicitHTTPTimeout(t *testing.T) {
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 5 * time.Minute,
+		LivenessThreshold: time.Hour,
+		HTTPTimeout:       time.Minute,
+		HeartbeatURL:      "https://example.com/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hb.SetInterval(time.Minute); err == nil {
+		t.Error("SetInterval to the explicit HTTPTimeout succeeded; want an error")
+	}
+	if got := hb.EffectiveHTTPTimeout(); got != time.Minute {
+		t.Errorf("EffectiveHTTPTimeout() = %s; want the explicit 1m0s", got)
+	}
+}
+
+func TestSetIntervalBeforeStartKeepsStatsDInterval(t *testing.T) {
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 5 * time.Minute,
+		LivenessThreshold: time.Hour,
+		StatsDAddr:        "127.0.0.1:8125",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hb.SetInterval(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := hb.(*heartbeat).statsDInterval; got != 5*time.Minute {
+		t.Errorf("StatsD interval after SetInterval = %s; want the configured 5m0s", got)
+	}
+}
+
+func TestAliveClockSkewReportedOnce(t *testing.T) {
+	reports := make(chan error, 100)
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Hour,
+		HeartbeatURL:      "http://127.0.0.1:0/",
+		MaxAliveSkew:      time.Second,
+		OnError:           func(err error) { reports <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		hb.Alive(time.Now().Add(time.Hour))
+	}
+	if lastAlive := hb.Stats().LastAlive; time.Until(lastAlive) > time.Second {
+		t.Errorf("LastAlive = %s; want it clamped to about now", lastAlive)
+	}
+
+	select {
+	case err := <-reports:
+		var hbErr *Error
+		if !errors.As(err, &hbErr) || hbErr.Kind != ErrorKindClockSkew {
+			t.Errorf("reported error = %v; want an ErrorKindClockSkew error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the clock skew to be reported")
+	}
+	select {
+	case err := <-reports:
+		t.Errorf("clock skew reported again within clockSkewReportInterval: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCheckRedirectFuncLimits(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	countRequests := func(checkRedirect func(*http.Request, []*http.Request) error) int {
+		requests = 0
+		client := &http.Client{CheckRedirect: checkRedirect}
+		if _, err := client.Get(srv.URL); err == nil {
+			t.Fatal("following an endless redirect loop succeeded")
+		}
+		return requests
+	}
+
+	// The default limit matches http.Client's own.
+	want := countRequests(nil)
+	if got := countRequests(checkRedirectFunc(0, true)); got != want {
+		t.Errorf("default limit sent %d requests; http.Client's default sends %d", got, want)
+	}
+	// An explicit limit follows exactly that many redirects.
+	if got := countRequests(checkRedirectFunc(3, false)); got != 4 {
+		t.Errorf("MaxRedirects 3 sent %d requests; want 4", got)
+	}
+}
+
+func TestStopFromCallbacks(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	succeeding, _ := newRecordingServer(t)
+
+	tests := []struct {
+		name string
+		url  string
+		cfg  func(cfg *Config, stop func())
+	}{
+		{"OnPersistentFailure", failing.URL, func(cfg *Config, stop func()) {
+			cfg.PersistentFailureThreshold = 1
+			cfg.OnPersistentFailure = stop
+		}},
+		{"OnSuccess", succeeding.URL, func(cfg *Config, stop func()) {
+			cfg.OnSuccess = func(Success) { stop() }
+		}},
+		{"OnStateChange", succeeding.URL, func(cfg *Config, stop func()) {
+			cfg.OnStateChange = func(bool) { stop() }
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hb Heartbeat
+			stopped := make(chan struct{})
+			cfg := &Config{
+				HeartbeatInterval: 100 * time.Millisecond,
+				LivenessThreshold: time.Hour,
+				HTTPTimeout:       50 * time.Millisecond,
+				HeartbeatURL:      tt.url,
+			}
+			tt.cfg(cfg, func() {
+				_ = hb.Stop()
+				close(stopped)
+			})
+			hb, err := NewHeartbeat(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hb.Alive(time.Now())
+			if err := hb.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Stop called from a callback didn't return")
+			}
+		})
+	}
+}
+
+func TestStateChangesDeliveredInOrder(t *testing.T) {
+	var delivered []bool
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Hour,
+		HeartbeatURL:      "http://127.0.0.1:0/",
+		OnStateChange: func(alive bool) {
+			if !alive {
+				// A slow handler for one state mustn't let a later transition overtake it.
+				time.Sleep(time.Millisecond)
+			}
+			delivered = append(delivered, alive)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hb.(*heartbeat)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				h.lastAlive.Store(time.Now().UnixNano())
+				h.observeLivenessUnlocked()
+				h.lastAlive.Store(0)
+				h.observeLivenessUnlocked()
+			}
+		}()
+	}
+	wg.Wait()
+	final := h.observeLivenessUnlocked()
+
+	drained := make(chan struct{})
+	h.callbacks.enqueue(func() { close(drained) })
+	<-drained
+	if len(delivered) == 0 {
+		t.Fatal("OnStateChange was never called")
+	}
+	for i := 1; i < len(delivered); i++ {
+		if delivered[i] == delivered[i-1] {
+			t.Fatalf("OnStateChange was called with %t twice in a row", delivered[i])
+		}
+	}
+	if last := delivered[len(delivered)-1]; last != final {
+		t.Errorf("last state delivered to OnStateChange = %t; want the final state, %t", last, final)
+	}
+}
+
+func TestValidateVerifyOnInitRequiresURL(t *testing.T) {
+	for _, cfg := range []*Config{
+		{HeartbeatInterval: time.Minute, LivenessThreshold: time.Minute, Port: 8080, VerifyOnInit: true},
+		{HeartbeatInterval: time.Minute, LivenessThreshold: time.Minute, StatsDAddr: "127.0.0.1:8125", VerifyOnInit: true},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() with VerifyOnInit and nothing to verify = nil; want an error")
+		}
+	}
+}
+
+func TestAliveChanAfterStop(t *testing.T) {
+	newUnstarted := func(t *testing.T) Heartbeat {
+		hb, err := NewHeartbeat(&Config{
+			HeartbeatInterval: time.Minute,
+			LivenessThreshold: time.Hour,
+			HeartbeatURL:      "http://127.0.0.1:0/",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hb
+	}
+	sendAll := func(t *testing.T, ch chan<- time.Time) {
+		t.Helper()
+		for i := 0; i < 5; i++ {
+			select {
+			case ch <- time.Now():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("send %d to AliveChan after Stop blocked", i+1)
+			}
+		}
+	}
+
+	t.Run("called before Stop", func(t *testing.T) {
+		hb := newUnstarted(t)
+		ch := hb.AliveChan()
+		_ = hb.Stop()
+		sendAll(t, ch)
+		if got := hb.Stats().LastAlive; !got.IsZero() {
+			t.Errorf("LastAlive after sends following Stop = %s; want the zero time", got)
+		}
+	})
+	t.Run("called after Stop", func(t *testing.T) {
+		hb := newUnstarted(t)
+		_ = hb.Stop()
+		sendAll(t, hb.AliveChan())
+	})
+	t.Run("combined", func(t *testing.T) {
+		hb := Combine(newUnstarted(t), newUnstarted(t))
+		ch := hb.AliveChan()
+		_ = hb.Stop()
+		sendAll(t, ch)
+	})
+}
@@ -0,0 +1,68 @@
+// Package heartbeathttp3 provides an HTTP/3 (QUIC) transport for heartbeat requests.
+// It is a separate module so that the heartbeat module doesn't depend on quic-go.
+package heartbeathttp3
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+var (
+	// ErrProxyUnsupported is returned for heartbeat requests which would be sent through a proxy
+	// (e.g. per Config.SOCKS5ProxyURL or the HTTPS_PROXY environment variable). HTTP/3 requests
+	// can't be sent through a proxy.
+	ErrProxyUnsupported = errors.New("heartbeathttp3: HTTP/3 requests can't be sent through a proxy")
+	// ErrDisableKeepAlivesUnsupported is returned for every heartbeat request if Config.DisableKeepAlives
+	// is set. HTTP/3 connections are always reused.
+	ErrDisableKeepAlivesUnsupported = errors.New("heartbeathttp3: DisableKeepAlives is not supported with HTTP/3")
+)
+
+// WrapTransport returns a function for use as heartbeat.Config.WrapTransport which sends
+// heartbeat requests over HTTP/3 instead of HTTP/1.1 or HTTP/2. HeartbeatURL and Targets must
+// use the https scheme. The TLS configuration of the default transport (e.g. per Config.TLSServerName)
+// is preserved. quicConfig may be nil to use quic-go's defaults.
+//
+// The default transport's proxy and keep-alive settings can't be applied to HTTP/3, so rather than
+// silently ignoring them, requests fail with ErrProxyUnsupported if they would be sent through a proxy,
+// and with ErrDisableKeepAlivesUnsupported if Config.DisableKeepAlives is set.
+func WrapTransport(quicConfig *quic.Config) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		wrapped := &roundTripper{h3: &http3.Transport{QUICConfig: quicConfig}}
+		if t, ok := rt.(*http.Transport); ok {
+			if t.TLSClientConfig != nil {
+				wrapped.h3.TLSClientConfig = t.TLSClientConfig.Clone()
+			}
+			wrapped.proxy = t.Proxy
+			wrapped.disableKeepAlives = t.DisableKeepAlives
+		}
+		return wrapped
+	}
+}
+
+// roundTripper sends requests via an http3.Transport, rejecting requests which depend on
+// settings of the wrapped transport that HTTP/3 can't honor.
+type roundTripper struct {
+	h3                *http3.Transport
+	proxy             func(*http.Request) (*url.URL, error)
+	disableKeepAlives bool
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.disableKeepAlives {
+		return nil, ErrDisableKeepAlivesUnsupported
+	}
+	if rt.proxy != nil {
+		proxyURL, err := rt.proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			return nil, ErrProxyUnsupported
+		}
+	}
+	return rt.h3.RoundTrip(req)
+}
@@ -0,0 +1,32 @@
+package heartbeathttp3
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestWrapTransportRejectsUnsupportedSettings(t *testing.T) {
+	socks5, _ := url.Parse("socks5://127.0.0.1:1080")
+	tests := []struct {
+		name      string
+		transport *http.Transport
+		want      error
+	}{
+		{"proxy", &http.Transport{Proxy: http.ProxyURL(socks5)}, ErrProxyUnsupported},
+		{"disable keep-alives", &http.Transport{DisableKeepAlives: true}, ErrDisableKeepAlivesUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := WrapTransport(nil)(tt.transport)
+			req, err := http.NewRequest(http.MethodGet, "https://example.invalid/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rt.RoundTrip(req); !errors.Is(err, tt.want) {
+				t.Errorf("RoundTrip error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/cdzombak/heartbeat/heartbeatotel
+
+go 1.21.3
+
+require go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.54.0
+
+require (
+	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel v1.29.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	go.opentelemetry.io/otel/trace v1.29.0 // indirect
+)
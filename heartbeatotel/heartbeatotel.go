@@ -0,0 +1,18 @@
+// Package heartbeatotel provides OpenTelemetry tracing for heartbeat requests.
+// It is a separate module so that the heartbeat module doesn't depend on OpenTelemetry.
+package heartbeatotel
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// WrapTransport returns a function for use as heartbeat.Config.WrapTransport which emits
+// an OpenTelemetry client span for each heartbeat request, recording its status code,
+// duration, and any error. The given options are passed to otelhttp.NewTransport.
+func WrapTransport(opts ...otelhttp.Option) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, opts...)
+	}
+}
@@ -0,0 +1,66 @@
+package heartbeat
+
+import "context"
+
+// signalKind is the status a heartbeat conveys to the monitor.
+type signalKind int
+
+const (
+	// signalUp indicates that the monitored program is alive.
+	signalUp signalKind = iota
+	// signalDown indicates that the monitored program is dead, or that a job failed.
+	signalDown
+	// signalStart indicates that a job has started.
+	signalStart
+	// signalComplete indicates that a job has completed successfully.
+	signalComplete
+)
+
+// signal is the content of a heartbeat.
+type signal struct {
+	kind signalKind
+	// msg describes the signal; for signalDown, if it's empty, a description of
+	// how long it has been since the last Alive call is sent instead.
+	msg string
+}
+
+// livenessSignal returns the signal for a scheduled heartbeat.
+func livenessSignal(up bool) signal {
+	if up {
+		return signal{kind: signalUp}
+	}
+	return signal{kind: signalDown}
+}
+
+// RunJob runs fn as a discrete job, such as a cron job, signaling HeartbeatURL and all Targets
+// per the configured Provider: a start signal is sent before fn is called (if the Provider supports
+// it), followed by a success signal if fn returns nil or a failure signal, with fn's error as its
+// message, otherwise. RunJob returns fn's error unchanged; failures to send signals are passed to
+// OnError. It doesn't require Start to have been called.
+func (h *heartbeat) RunJob(ctx context.Context, fn func() error) error {
+	if h.provider.hasStartSignal() || h.transport == TransportWebSocket {
+		h.signalAll(ctx, signal{kind: signalStart})
+	}
+
+	err := fn()
+	if err == nil {
+		h.signalAll(ctx, signal{kind: signalComplete})
+		return nil
+	}
+
+	msg := err.Error()
+	if msg == "" {
+		msg = "job failed"
+	}
+	h.signalAll(ctx, signal{kind: signalDown, msg: msg})
+	return err
+}
+
+// signalAll sends the given signal to all targets, reporting any failures via OnError.
+func (h *heartbeat) signalAll(ctx context.Context, sig signal) {
+	for _, t := range h.targets {
+		if err := h.send(ctx, t, sig, 0); err != nil {
+			h.reportError(err)
+		}
+	}
+}
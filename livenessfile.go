@@ -0,0 +1,22 @@
+package heartbeat
+
+import (
+	"os"
+	"time"
+)
+
+// livenessFileTime returns the modification time of LivenessFile, which indicates when an
+// external process was last alive.
+func (h *heartbeat) livenessFileTime() (time.Time, error) {
+	fi, err := os.Stat(h.livenessFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// livenessFileAlive reports whether LivenessFile exists and was modified within LivenessThreshold.
+func (h *heartbeat) livenessFileAlive() bool {
+	mtime, err := h.livenessFileTime()
+	return err == nil && time.Since(mtime) < h.livenessThreshold
+}
@@ -0,0 +1,15 @@
+package heartbeat
+
+import "log/slog"
+
+// Logger is the logging interface used by Config.Logger. Its methods take a message followed by
+// alternating keys and values, as *slog.Logger's do; a *slog.Logger can be used as a Logger
+// directly, and other logging libraries (e.g. zerolog or logrus) can be adapted to it.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var _ Logger = (*slog.Logger)(nil)
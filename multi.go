@@ -0,0 +1,204 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Combine returns a Heartbeat which forwards each method call to all the given Heartbeats,
+// allowing independent implementations (e.g. a push heartbeat and a separate health server)
+// to be used as one. Errors returned by the children are joined.
+func Combine(heartbeats ...Heartbeat) Heartbeat {
+	return &multi{hbs: append([]Heartbeat(nil), heartbeats...)}
+}
+
+type multi struct {
+	hbs       []Heartbeat
+	aliveOnce sync.Once
+	aliveChan chan time.Time
+}
+
+func (m *multi) Start() error {
+	return m.each(Heartbeat.Start)
+}
+
+func (m *multi) Alive(at time.Time) {
+	for _, hb := range m.hbs {
+		hb.Alive(at)
+	}
+}
+
+// AliveChan returns a channel on which sending a time is equivalent to calling Alive with it.
+// It has the same buffering as the channel returned by a single Heartbeat's AliveChan, and is
+// likewise drained even after Stop or Close is called.
+func (m *multi) AliveChan() chan<- time.Time {
+	m.aliveOnce.Do(func() {
+		m.aliveChan = make(chan time.Time, 1)
+		go func() {
+			for at := range m.aliveChan {
+				m.Alive(at)
+			}
+		}()
+	})
+	return m.aliveChan
+}
+
+func (m *multi) AliveUntil(deadline time.Time) {
+	for _, hb := range m.hbs {
+		hb.AliveUntil(deadline)
+	}
+}
+
+func (m *multi) ServerErr() error {
+	return m.each(Heartbeat.ServerErr)
+}
+
+// EffectiveHTTPTimeout returns the longest of the children's effective HTTP timeouts.
+func (m *multi) EffectiveHTTPTimeout() time.Duration {
+	var timeout time.Duration
+	for _, hb := range m.hbs {
+		timeout = max(timeout, hb.EffectiveHTTPTimeout())
+	}
+	return timeout
+}
+
+func (m *multi) Stop() error {
+	return m.each(Heartbeat.Stop)
+}
+
+func (m *multi) Close() error {
+	return m.each(Heartbeat.Close)
+}
+
+func (m *multi) ForceUnhealthy(force bool) {
+	for _, hb := range m.hbs {
+		hb.ForceUnhealthy(force)
+	}
+}
+
+func (m *multi) SendNow(ctx context.Context) error {
+	return m.each(func(hb Heartbeat) error { return hb.SendNow(ctx) })
+}
+
+func (m *multi) SendNowTimeout(d time.Duration) error {
+	return m.each(func(hb Heartbeat) error { return hb.SendNowTimeout(d) })
+}
+
+// Stats returns the latest LastAlive and LastSuccess across the children,
+// and their SendIntervals combined (per URL).
+func (m *multi) Stats() Stats {
+	var stats Stats
+	for _, hb := range m.hbs {
+		s := hb.Stats()
+		if s.LastAlive.After(stats.LastAlive) {
+			stats.LastAlive = s.LastAlive
+		}
+		if s.LastSuccess.After(stats.LastSuccess) {
+			stats.LastSuccess = s.LastSuccess
+		}
+		for url, intervals := range s.SendIntervals {
+			if stats.SendIntervals == nil {
+				stats.SendIntervals = make(map[string]IntervalStats)
+			}
+			stats.SendIntervals[url] = stats.SendIntervals[url].merge(intervals)
+		}
+	}
+	return stats
+}
+
+// EffectiveConfig returns the zero Config, since a combined Heartbeat has no single configuration.
+func (m *multi) EffectiveConfig() Config {
+	return Config{}
+}
+
+func (m *multi) SetOnError(fn func(error)) {
+	for _, hb := range m.hbs {
+		hb.SetOnError(fn)
+	}
+}
+
+// Describe joins the children's descriptions with "; ".
+func (m *multi) Describe() string {
+	descriptions := make([]string, len(m.hbs))
+	for i, hb := range m.hbs {
+		descriptions[i] = hb.Describe()
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// RunJob runs fn once, nesting it within each child's RunJob so that every child signals
+// the job's start and outcome.
+func (m *multi) RunJob(ctx context.Context, fn func() error) error {
+	for i := len(m.hbs) - 1; i >= 0; i-- {
+		hb, inner := m.hbs[i], fn
+		fn = func() error { return hb.RunJob(ctx, inner) }
+	}
+	return fn()
+}
+
+// BoundAddrs returns all the children's bound addresses.
+func (m *multi) BoundAddrs() []net.Addr {
+	var addrs []net.Addr
+	for _, hb := range m.hbs {
+		addrs = append(addrs, hb.BoundAddrs()...)
+	}
+	return addrs
+}
+
+func (m *multi) RecordExternalSend(success bool, at time.Time) {
+	for _, hb := range m.hbs {
+		hb.RecordExternalSend(success, at)
+	}
+}
+
+func (m *multi) AliveSource(name string, at time.Time) {
+	for _, hb := range m.hbs {
+		hb.AliveSource(name, at)
+	}
+}
+
+func (m *multi) Drain() {
+	for _, hb := range m.hbs {
+		hb.Drain()
+	}
+}
+
+func (m *multi) Pause() {
+	for _, hb := range m.hbs {
+		hb.Pause()
+	}
+}
+
+func (m *multi) Resume() {
+	for _, hb := range m.hbs {
+		hb.Resume()
+	}
+}
+
+func (m *multi) SetInterval(d time.Duration) error {
+	return m.each(func(hb Heartbeat) error { return hb.SetInterval(d) })
+}
+
+// ConsecutiveFailures returns the most consecutive failures of any of the children.
+func (m *multi) ConsecutiveFailures() int {
+	n := 0
+	for _, hb := range m.hbs {
+		n = max(n, hb.ConsecutiveFailures())
+	}
+	return n
+}
+
+// each calls f for each child and joins the resulting errors.
+func (m *multi) each(f func(Heartbeat) error) error {
+	var errs []error
+	for _, hb := range m.hbs {
+		if err := f(hb); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package heartbeat
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// NewNoop returns a Heartbeat whose methods do nothing. It is useful when monitoring is disabled,
+// allowing callers to use a Heartbeat unconditionally rather than checking for nil.
+func NewNoop() Heartbeat {
+	return noop{}
+}
+
+type noop struct{}
+
+func (noop) Start() error                                    { return nil }
+func (noop) Alive(time.Time)                                 {}
+func (noop) AliveUntil(time.Time)                            {}
+func (noop) ServerErr() error                                { return nil }
+func (noop) EffectiveHTTPTimeout() time.Duration             { return 0 }
+func (noop) Stop() error                                     { return nil }
+func (noop) Close() error                                    { return nil }
+func (noop) ForceUnhealthy(bool)                             {}
+func (noop) SendNow(context.Context) error                   { return nil }
+func (noop) SendNowTimeout(time.Duration) error              { return nil }
+func (noop) Stats() Stats                                    { return Stats{} }
+func (noop) EffectiveConfig() Config                         { return Config{} }
+func (noop) SetOnError(func(error))                          {}
+func (noop) Describe() string                                { return "disabled" }
+func (noop) RunJob(_ context.Context, fn func() error) error { return fn() }
+func (noop) BoundAddrs() []net.Addr                          { return nil }
+func (noop) RecordExternalSend(bool, time.Time)              {}
+func (noop) AliveSource(string, time.Time)                   {}
+func (noop) Drain()                                          {}
+func (noop) Pause()                                          {}
+func (noop) Resume()                                         {}
+func (noop) SetInterval(time.Duration) error                 { return nil }
+func (noop) ConsecutiveFailures() int                        { return 0 }
+func (noop) AliveChan() chan<- time.Time                     { return noopAliveChan() }
+
+var (
+	noopAliveOnce sync.Once
+	noopAlive     chan time.Time
+)
+
+// noopAliveChan returns a channel shared by all noop Heartbeats, drained by a single goroutine,
+// so that sends to a noop Heartbeat's AliveChan never block for long.
+func noopAliveChan() chan<- time.Time {
+	noopAliveOnce.Do(func() {
+		noopAlive = make(chan time.Time, 1)
+		go func() {
+			for range noopAlive {
+			}
+		}()
+	})
+	return noopAlive
+}
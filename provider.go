@@ -0,0 +1,148 @@
+package heartbeat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Provider selects the conventions of a particular monitoring service for sending heartbeats.
+type Provider int
+
+const (
+	// ProviderGeneric sends heartbeats as GET requests, and any 2xx response (or a response with one of
+	// AcceptStatusCodes) indicates success, even if the response body can't be read. For compatibility with
+	// Uptime Kuma, a JSON response body with "ok": false is treated as a failure, and down statuses use
+	// Uptime Kuma's status and msg query parameters. This is the default.
+	ProviderGeneric Provider = iota
+	// ProviderUptimeKuma follows Uptime Kuma push monitor conventions: a JSON response body with
+	// "ok": false indicates failure, and down statuses set the status=down and msg query parameters.
+	// A failure to read the response body is reported as an ErrorKindResponse error. An empty or
+	// malformed response body is treated as success unless StrictUptimeKumaResponse is set.
+	ProviderUptimeKuma
+	// ProviderHealthchecks follows Healthchecks.io conventions: the response body must begin with "OK"
+	// (so a failure to read it is an ErrorKindResponse error), and down statuses are sent to the heartbeat
+	// URL with a "/fail" path suffix.
+	ProviderHealthchecks
+	// ProviderCronitor follows Cronitor telemetry conventions: down statuses set the state=fail
+	// and message query parameters.
+	ProviderCronitor
+	// ProviderDeadMansSnitch follows Dead Man's Snitch conventions: down statuses set the s=1
+	// (a nonzero exit status) and m (message) query parameters.
+	ProviderDeadMansSnitch
+)
+
+func (p Provider) valid() bool {
+	return p >= ProviderGeneric && p <= ProviderDeadMansSnitch
+}
+
+// requiresBody reports whether the provider needs a 2xx response's body to determine
+// whether the heartbeat succeeded.
+func (p Provider) requiresBody() bool {
+	return p == ProviderUptimeKuma || p == ProviderHealthchecks
+}
+
+// signalURL returns u modified to convey the given signal (and, for signalDown, the given message).
+// u's query must be given as q, which is encoded into the returned URL.
+func (p Provider) signalURL(u *url.URL, q url.Values, kind signalKind, msg string) *url.URL {
+	switch kind {
+	case signalDown:
+		return p.downURL(u, q, msg)
+	case signalStart:
+		switch p {
+		case ProviderHealthchecks:
+			u = u.JoinPath("start")
+		case ProviderCronitor:
+			q.Set("state", "run")
+		}
+	case signalComplete:
+		if p == ProviderCronitor {
+			q.Set("state", "complete")
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
+
+// hasStartSignal reports whether the provider supports signaling that a job has started.
+func (p Provider) hasStartSignal() bool {
+	return p == ProviderHealthchecks || p == ProviderCronitor
+}
+
+// downURL returns u modified to signal a down status with the given message.
+// u's query must be given as q, which is encoded into the returned URL.
+func (p Provider) downURL(u *url.URL, q url.Values, msg string) *url.URL {
+	switch p {
+	case ProviderHealthchecks:
+		u = u.JoinPath("fail")
+	case ProviderCronitor:
+		q.Set("state", "fail")
+		q.Set("message", msg)
+	case ProviderDeadMansSnitch:
+		q.Set("s", "1")
+		q.Set("m", msg)
+	default:
+		q.Set("status", "down")
+		q.Set("msg", msg)
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
+
+// checkResponse returns an error if the given response body from a 2xx response
+// indicates that the heartbeat failed.
+//
+// An empty or malformed body is not a failure unless strictKuma is set and the provider is
+// ProviderUptimeKuma.
+func (p Provider) checkResponse(body []byte, strictKuma bool) error {
+	switch p {
+	case ProviderGeneric, ProviderUptimeKuma:
+		var ukRespBody uptimeKumaPushResp
+		err := json.Unmarshal(body, &ukRespBody)
+		if err == nil && !ukRespBody.OK {
+			return errors.New(ukRespBody.Msg)
+		}
+		if err != nil && strictKuma && p == ProviderUptimeKuma {
+			if len(body) == 0 {
+				return errors.New("empty response body")
+			}
+			return fmt.Errorf("malformed response body: %w", err)
+		}
+	case ProviderHealthchecks:
+		if !bytes.HasPrefix(body, []byte("OK")) {
+			return fmt.Errorf("unexpected response: %q", body)
+		}
+	}
+	return nil
+}
+
+// JSONResponseValidator returns a function for use as Config.ResponseValidator which, like
+// ProviderUptimeKuma, treats a JSON response body whose boolean okField is false as a failure,
+// with the string msgField (if present) as the error message. It is useful for monitors
+// (such as Uptime Kuma forks) whose responses use different field names. Bodies which aren't
+// JSON objects, or which lack okField, are treated as success.
+func JSONResponseValidator(okField, msgField string) func(body []byte) error {
+	return func(body []byte) error {
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil
+		}
+		var ok bool
+		if err := json.Unmarshal(resp[okField], &ok); err != nil || ok {
+			return nil
+		}
+		var msg string
+		_ = json.Unmarshal(resp[msgField], &msg)
+		if msg == "" {
+			msg = fmt.Sprintf("response has %s: false", okField)
+		}
+		return errors.New(msg)
+	}
+}
+
+type uptimeKumaPushResp struct {
+	OK  bool   `json:"ok"`
+	Msg string `json:"msg"`
+}
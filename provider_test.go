@@ -0,0 +1,40 @@
+package heartbeat
+
+import "testing"
+
+func TestCheckResponseUptimeKuma(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		strict     bool
+		wantFailed bool
+	}{
+		{"ok", `{"ok":true}`, false, false},
+		{"ok strict", `{"ok":true}`, true, false},
+		{"ok false", `{"ok":false,"msg":"monitor not found"}`, false, true},
+		{"ok false strict", `{"ok":false,"msg":"monitor not found"}`, true, true},
+		{"empty", ``, false, false},
+		{"empty strict", ``, true, true},
+		{"malformed", `<html>bad gateway</html>`, false, false},
+		{"malformed strict", `<html>bad gateway</html>`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ProviderUptimeKuma.checkResponse([]byte(tt.body), tt.strict)
+			if failed := err != nil; failed != tt.wantFailed {
+				t.Errorf("checkResponse(%q, strict=%v) = %v, want failure %v", tt.body, tt.strict, err, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestCheckResponseGenericIgnoresStrict(t *testing.T) {
+	for _, body := range []string{``, `<html>bad gateway</html>`} {
+		if err := ProviderGeneric.checkResponse([]byte(body), true); err != nil {
+			t.Errorf("checkResponse(%q, strict=true) = %v, want nil for ProviderGeneric", body, err)
+		}
+	}
+	if err := ProviderGeneric.checkResponse([]byte(`{"ok":false,"msg":"nope"}`), false); err == nil || err.Error() != "nope" {
+		t.Errorf(`checkResponse({"ok":false}) = %v, want "nope"`, err)
+	}
+}
@@ -0,0 +1,562 @@
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processStart approximates the time the process started, for IncludeUptime.
+var processStart = time.Now()
+
+func (h *heartbeat) startHeartbeatLocked() {
+	for _, t := range h.targets {
+		h.startTargetLocked(t)
+	}
+}
+
+// startTargetLocked starts sending heartbeats to the given target on its own schedule.
+func (h *heartbeat) startTargetLocked(t *target) {
+	ticker := time.NewTicker(t.interval)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer ticker.Stop()
+		defer h.closeWebSocket(t)
+		interval := t.interval
+
+		// Per StartBurstCount, send a burst of heartbeats before settling into the regular schedule.
+		if h.startBurstCount > 1 {
+			for i := 0; i < h.startBurstCount; i++ {
+				if i > 0 {
+					select {
+					case <-h.done:
+						return
+					case <-time.After(h.startBurstSpacing):
+					}
+				}
+				if !h.isPaused() {
+					_, _ = h.sendScheduled(t)
+				}
+			}
+			ticker.Reset(interval)
+		}
+
+		realign := false // whether the ticker must be reset to interval after its next tick
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+				if realign {
+					ticker.Reset(interval)
+					realign = false
+				}
+			case <-t.wake:
+				// Per SendOnResume or SendOnRecovery, send now, then continue on a fresh schedule.
+				interval = t.interval
+				ticker.Reset(interval)
+				realign = false
+				t.lastTick = time.Time{}
+			case d := <-t.newInterval:
+				// Per SetInterval, schedule the next heartbeat one new interval after the last,
+				// sending now if that time has passed.
+				t.interval, interval = d, d
+				wait := d
+				if !t.lastTick.IsZero() {
+					wait = time.Until(t.lastTick.Add(d))
+				}
+				if wait > 0 {
+					ticker.Reset(wait)
+					realign = wait != d
+					continue
+				}
+				ticker.Reset(d)
+				realign = false
+			}
+			if h.isPaused() {
+				continue
+			}
+
+			// After a pause (e.g. GC or CPU starvation), a backed-up tick may fire soon after the
+			// previous one; skip it to keep heartbeats spaced sanely.
+			now := time.Now()
+			if !t.lastTick.IsZero() && now.Sub(t.lastTick) < t.interval/2 {
+				continue
+			}
+			if h.recordSendIntervals && !t.lastTick.IsZero() {
+				h.recordSendIntervalUnlocked(t, now.Sub(t.lastTick))
+			}
+			t.lastTick = now
+
+			sent, err := h.sendScheduled(t)
+			if !sent {
+				continue
+			}
+
+			// Per FailureBackoffMax, back off exponentially during sustained failures,
+			// and return to the normal interval on success.
+			if h.failureBackoffMax > 0 {
+				next := t.interval
+				if err != nil {
+					next = max(min(2*interval, h.failureBackoffMax), t.interval)
+				}
+				if next != interval {
+					interval = next
+					ticker.Reset(interval)
+				}
+			}
+		}
+	}()
+}
+
+// sendScheduled sends a scheduled heartbeat to the given target conveying the current liveness,
+// unless it's skipped per SendOnlyOnChange or SendDownStatus. It reports whether a heartbeat was
+// sent, and returns its error (having passed it to OnError) if it failed.
+func (h *heartbeat) sendScheduled(t *target) (bool, error) {
+	up := h.observeLivenessUnlocked()
+	if up && h.sendOnRecovery {
+		// Observing a recovery here wakes this sender too, but it's about to send anyway.
+		select {
+		case <-t.wake:
+		default:
+		}
+	}
+	if !up && h.alwaysSend && h.forcedDownMessageUnlocked() == "" {
+		// Per AlwaysSend, a lapse in liveness doesn't stop heartbeats.
+		up = true
+	}
+	if h.sendOnlyOnChange && t.sent && t.sentUp == up {
+		return false, nil
+	}
+	if !up && !h.sendDownStatus {
+		t.sentUp = false
+		return false, nil
+	}
+	err := h.send(h.requestContext(), t, livenessSignal(up), h.retries)
+	if err != nil {
+		h.reportError(err)
+		return true, err
+	}
+	t.sent = true
+	t.sentUp = up
+	return true, nil
+}
+
+// recordSendIntervalUnlocked records an actual interval between scheduled heartbeats to the
+// given target, per RecordSendIntervals.
+func (h *heartbeat) recordSendIntervalUnlocked(t *target, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t.sendIntervals.Count == 0 || d < t.sendIntervals.Min {
+		t.sendIntervals.Min = d
+	}
+	t.sendIntervals.Max = max(t.sendIntervals.Max, d)
+	t.sendIntervals.Count++
+	t.sendIntervalsSum += d
+}
+
+// requestContext returns the base context for a scheduled heartbeat request.
+func (h *heartbeat) requestContext() context.Context {
+	if h.contextFunc != nil {
+		if ctx := h.contextFunc(); ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// SendNow immediately sends a heartbeat to HeartbeatURL and all Targets, regardless of
+// liveness and of the regular heartbeat schedule. It returns an error (wrapping each failed
+// heartbeat's *Error) if any heartbeat failed; these errors are not passed to OnError.
+//
+// Each heartbeat request is bounded by both ctx and HTTPTimeout, whichever expires first, so a
+// deadline on ctx may shorten (but not extend) the timeout for this call. A request which exceeds
+// ctx's deadline fails with ErrorKindTimeout. Scheduled heartbeats are unaffected.
+//
+// Stop waits for in-flight calls to SendNow to complete; their requests aren't canceled.
+// After Stop, SendNow returns ErrStopped without sending anything.
+func (h *heartbeat) SendNow(ctx context.Context) error {
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		return ErrStopped
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+	defer h.wg.Done()
+
+	var errs []error
+	for _, t := range h.targets {
+		if err := h.send(ctx, t, signal{kind: signalUp}, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendNowTimeout is like SendNow, with a context that times out after the given duration.
+func (h *heartbeat) SendNowTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return h.SendNow(ctx)
+}
+
+// send sends a heartbeat conveying the given signal to the given target, records its outcome,
+// and passes it to OnSuccess if it succeeded.
+// Retryable failures are retried up to the given number of times, unless ctx is canceled or
+// the heartbeat is stopped. It returns a non-nil *Error if the heartbeat failed.
+func (h *heartbeat) send(ctx context.Context, t *target, sig signal, retries int) error {
+	var (
+		success Success
+		err     *Error
+	)
+	for attempt := 0; ; attempt++ {
+		if h.transport == TransportWebSocket {
+			start := time.Now()
+			err = h.sendWebSocket(ctx, t, sig)
+			success = Success{Latency: time.Since(start)}
+		} else {
+			success, err = h.sendHTTP(ctx, t, sig)
+		}
+		if err != nil {
+			err.URL = t.url
+		}
+		if err == nil || attempt >= retries || !h.retryable(err) || !h.waitRetry(ctx) {
+			break
+		}
+	}
+
+	if h.logger != nil {
+		if err == nil {
+			h.logger.Debug("heartbeat sent", "url", redactURL(t.url), "status", success.StatusCode, "latency", success.Latency)
+		} else {
+			h.logger.Error("heartbeat failed", "url", redactURL(t.url), "error", err)
+		}
+	}
+
+	h.recordEvent(t.url, success, err)
+	h.record(t, err == nil, sig.kind == signalUp || sig.kind == signalComplete, time.Now())
+	if err != nil {
+		return err
+	}
+	success.URL = t.url
+	if h.latencyBudget > 0 && success.Latency > h.latencyBudget {
+		slowErr := &Error{Kind: ErrorKindSlow, URL: t.url, RequestID: success.RequestID, StatusCode: success.StatusCode,
+			Err: fmt.Errorf("took %s, exceeding the latency budget of %s", success.Latency, h.latencyBudget)}
+		if h.logger != nil {
+			h.logger.Warn("heartbeat was slow", "url", redactURL(t.url), "latency", success.Latency, "budget", h.latencyBudget)
+		}
+		h.reportError(slowErr)
+	}
+	if h.onSuccess != nil {
+		h.callbacks.enqueue(func() { h.onSuccess(success) })
+	}
+	return nil
+}
+
+// record records the outcome of a heartbeat sent to the given target at the given time,
+// queueing a call to OnPersistentFailure if the target's consecutive failures reach PersistentFailureThreshold,
+// or OnRecovery if it succeeded after failing. Only a successful heartbeat which signaled that the program
+// is working (up is set) updates the target's last success, per Stats.LastSuccess.
+func (h *heartbeat) record(t *target, ok, up bool, at time.Time) {
+	h.mu.Lock()
+	if ok {
+		failed := t.consecutiveFailures
+		t.consecutiveFailures = 0
+		if up && at.After(t.lastSuccess) {
+			t.lastSuccess = at
+		}
+		h.mu.Unlock()
+
+		if failed > 0 && h.onRecovery != nil {
+			h.callbacks.enqueue(func() { h.onRecovery(failed) })
+		}
+		return
+	}
+	t.consecutiveFailures++
+	persistent := h.persistentFailureThreshold > 0 && t.consecutiveFailures == h.persistentFailureThreshold
+	h.mu.Unlock()
+
+	if persistent && h.onPersistentFailure != nil {
+		h.callbacks.enqueue(h.onPersistentFailure)
+	}
+}
+
+// ConsecutiveFailures returns the number of consecutive heartbeats that have failed to whichever of
+// HeartbeatURL, the Targets, and (if RecordExternalSend has been called) the external target has the
+// most; it is 0 if the latest heartbeat to each succeeded. It's reset for each target by a successful
+// heartbeat, allowing callers to implement their own alerting thresholds.
+func (h *heartbeat) ConsecutiveFailures() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := 0
+	for _, t := range h.trackedTargetsLocked() {
+		n = max(n, t.consecutiveFailures)
+	}
+	return n
+}
+
+// RecordExternalSend records the outcome of a heartbeat sent at the given time by something other than
+// this Heartbeat (e.g. a sidecar), without sending a request. It's tracked like a heartbeat to another
+// target: it's reflected in Stats and Describe, and counts toward PushFailureThreshold and
+// PersistentFailureThreshold. Liveness is then re-evaluated, calling OnStateChange if it has changed.
+// A zero time is replaced with the current time.
+func (h *heartbeat) RecordExternalSend(success bool, at time.Time) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	h.mu.Lock()
+	if h.external == nil {
+		h.external = &target{}
+	}
+	t := h.external
+	h.mu.Unlock()
+
+	h.record(t, success, true, at)
+	h.observeLivenessUnlocked()
+}
+
+// trackedTargetsLocked returns all targets whose heartbeats are tracked: HeartbeatURL, Targets,
+// and (if RecordExternalSend has been called) the external target.
+func (h *heartbeat) trackedTargetsLocked() []*target {
+	if h.external == nil {
+		return h.targets
+	}
+	return append(h.targets[:len(h.targets):len(h.targets)], h.external)
+}
+
+// waitRetry waits retryDelay before a heartbeat is retried. It returns false if ctx is canceled
+// or the heartbeat is stopped first.
+func (h *heartbeat) waitRetry(ctx context.Context) bool {
+	timer := time.NewTimer(retryDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-h.done:
+		return false
+	}
+}
+
+// requestURLUnlocked returns the URL to request for a heartbeat to the given heartbeat URL,
+// with QueryParams and QueryParamsFunc's parameters (and the uptime parameter, if IncludeUptime
+// is set) merged into its query.
+// Unless sig is signalUp, the URL is modified to convey sig per the configured Provider.
+func (h *heartbeat) requestURLUnlocked(heartbeatURL string, sig signal) (string, error) {
+	if sig.kind == signalUp && h.queryParams == nil && h.queryParamsFunc == nil && !h.includeUptime {
+		return heartbeatURL, nil
+	}
+
+	u, err := url.Parse(heartbeatURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse heartbeat URL '%s': %w", heartbeatURL, err)
+	}
+
+	q := u.Query()
+	for k, v := range h.queryParams {
+		q[k] = v
+	}
+	if h.queryParamsFunc != nil {
+		for k, v := range h.queryParamsFunc() {
+			q[k] = v
+		}
+	}
+	if h.includeUptime {
+		q.Set("uptime", strconv.FormatInt(int64(time.Since(processStart)/time.Second), 10))
+	}
+	return h.provider.signalURL(u, q, sig.kind, h.signalMessageUnlocked(sig)).String(), nil
+}
+
+// signalMessageUnlocked returns the message to send with sig: its own message if set, or for
+// a down status, a description of why the heartbeat is down.
+func (h *heartbeat) signalMessageUnlocked(sig signal) string {
+	if sig.msg != "" || sig.kind != signalDown {
+		return sig.msg
+	}
+	return h.downMessageUnlocked()
+}
+
+// downMessageUnlocked describes how long it has been since the last Alive() call or modification of
+// LivenessFile (or that the heartbeat is draining or has been forced unhealthy).
+func (h *heartbeat) downMessageUnlocked() string {
+	lastAlive := h.lastAliveTime()
+	if msg := h.forcedDownMessageUnlocked(); msg != "" {
+		return msg
+	}
+	if stale := h.staleSources(); len(h.sourceNames) > 0 && len(stale) > 0 {
+		return fmt.Sprintf("no recent activity from %s (threshold %s)", strings.Join(stale, ", "), h.livenessThreshold)
+	}
+	if h.livenessFile != "" {
+		mtime, err := h.livenessFileTime()
+		if err != nil {
+			return fmt.Sprintf("liveness file unavailable: %s", err)
+		}
+		lastAlive = mtime
+	}
+	if lastAlive.IsZero() {
+		return fmt.Sprintf("no activity recorded (threshold %s)", h.livenessThreshold)
+	}
+	return fmt.Sprintf("no activity for %s (threshold %s)", time.Since(lastAlive).Round(time.Second), h.livenessThreshold)
+}
+
+// forcedDownMessageUnlocked describes why the heartbeat is down regardless of liveness: it's draining
+// or has been forced unhealthy. It returns "" if neither applies.
+func (h *heartbeat) forcedDownMessageUnlocked() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return "draining"
+	}
+	if h.forceUnhealthy {
+		return "forced unhealthy"
+	}
+	return ""
+}
+
+// sendHTTP sends a heartbeat request to the given target. It returns a Success describing the
+// request (without its URL) if the heartbeat succeeded, or a non-nil *Error if it failed.
+// Latency is measured from sending the request until its response body has been read.
+//
+// If UseETag is set, a 304 Not Modified response to a request with If-None-Match is a success.
+//
+// If the response has a successful status but its body can't be read, the heartbeat fails only if
+// the body is needed to determine success: when the provider requires it (see Provider.requiresBody)
+// or when ResponseValidator, ExpectBodyContains, or ExpectBodyRegex is set.
+func (h *heartbeat) sendHTTP(ctx context.Context, t *target, sig signal) (Success, *Error) {
+	u, err := h.requestURLUnlocked(t.url, sig)
+	if err != nil {
+		return Success{}, &Error{Kind: ErrorKindRequest, Err: err}
+	}
+
+	var requestID string
+	if h.generateRequestID {
+		if requestID, err = newRequestID(); err != nil {
+			return Success{}, &Error{Kind: ErrorKindRequest, Err: fmt.Errorf("failed to generate request ID: %w", err)}
+		}
+	}
+
+	method, body, contentType := http.MethodGet, []byte(nil), ""
+	if sig.kind == signalDown && h.downBody != nil {
+		method = http.MethodPost
+		body, contentType = h.downBody(h.signalMessageUnlocked(sig))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return Success{}, &Error{Kind: ErrorKindRequest, RequestID: requestID, Err: err}
+	}
+	if h.hostHeader != "" {
+		req.Host = h.hostHeader
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if requestID != "" {
+		req.Header.Set(h.requestIDHeader, requestID)
+	}
+	useETag := h.useETag && sig.kind == signalUp
+	if useETag {
+		h.mu.Lock()
+		if t.etag != "" {
+			req.Header.Set("If-None-Match", t.etag)
+		}
+		h.mu.Unlock()
+	}
+	if h.requestInspector != nil {
+		h.requestInspector(req)
+	}
+
+	start := time.Now()
+	resp, err := h.client.Load().Do(req)
+	if err != nil {
+		return Success{}, &Error{Kind: requestErrorKind(err), RequestID: requestID, Err: err}
+	}
+	if useETag && resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		resp.Body.Close()
+		return Success{StatusCode: resp.StatusCode, Latency: time.Since(start), RequestID: requestID}, nil
+	}
+	if !h.statusOK(resp.StatusCode) {
+		resp.Body.Close()
+		return Success{}, &Error{Kind: ErrorKindStatus, RequestID: requestID, StatusCode: resp.StatusCode, Err: errors.New(resp.Status)}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	success := Success{StatusCode: resp.StatusCode, Latency: time.Since(start), RequestID: requestID}
+	if err != nil {
+		if h.provider.requiresBody() || h.responseValidator != nil || h.expectBodyContains != "" || h.expectBodyRegex != nil {
+			return Success{}, &Error{Kind: ErrorKindResponse, RequestID: requestID, StatusCode: resp.StatusCode, Err: fmt.Errorf("failed to read response: %w", err)}
+		}
+		if useETag {
+			h.storeETag(t, resp)
+		}
+		return success, nil
+	}
+
+	checkResponse := h.responseValidator
+	if checkResponse == nil {
+		checkResponse = func(body []byte) error { return h.provider.checkResponse(body, h.strictUptimeKumaResponse) }
+	}
+	if err := checkResponse(bodyBytes); err != nil {
+		return Success{}, &Error{Kind: ErrorKindResponse, RequestID: requestID, StatusCode: resp.StatusCode, Err: err}
+	}
+	if h.expectBodyContains != "" && !bytes.Contains(bodyBytes, []byte(h.expectBodyContains)) {
+		return Success{}, &Error{Kind: ErrorKindResponse, RequestID: requestID, StatusCode: resp.StatusCode,
+			Err: fmt.Errorf("response body does not contain %q", h.expectBodyContains)}
+	}
+	if h.expectBodyRegex != nil && !h.expectBodyRegex.Match(bodyBytes) {
+		return Success{}, &Error{Kind: ErrorKindResponse, RequestID: requestID, StatusCode: resp.StatusCode,
+			Err: fmt.Errorf("response body does not match %q", h.expectBodyRegex)}
+	}
+	if useETag {
+		h.storeETag(t, resp)
+	}
+	return success, nil
+}
+
+// storeETag records the ETag of a successful heartbeat response for the given target,
+// to be sent in the If-None-Match header of subsequent heartbeat requests.
+func (h *heartbeat) storeETag(t *target, resp *http.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t.etag = resp.Header.Get("ETag")
+}
+
+// statusOK reports whether the given HTTP status code indicates a successful heartbeat.
+func (h *heartbeat) statusOK(code int) bool {
+	if code >= 200 && code <= 299 {
+		return true
+	}
+	for _, c := range h.acceptStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,193 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTruncatingServer returns a server which responds with 200 OK, then closes the connection
+// partway through the response body.
+func newTruncatingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"ok\":tr")
+		_ = buf.Flush()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBodyReadFailure(t *testing.T) {
+	srv := newTruncatingServer(t)
+
+	tests := []struct {
+		name     string
+		provider Provider
+		wantErr  bool
+	}{
+		// The generic provider doesn't need the body, so a 2xx status is enough.
+		{"generic", ProviderGeneric, false},
+		// Uptime Kuma's body indicates success, so failing to read it is a failure.
+		{"uptime kuma", ProviderUptimeKuma, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hb, err := NewHeartbeat(&Config{
+				HeartbeatInterval: time.Minute,
+				LivenessThreshold: time.Minute,
+				HeartbeatURL:      srv.URL,
+				Provider:          tt.provider,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = hb.SendNowTimeout(5 * time.Second)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("SendNow() = %v, want nil", err)
+				}
+				return
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("SendNow() = %v, want an *Error", err)
+			}
+			if e.Kind != ErrorKindResponse || e.StatusCode != http.StatusOK {
+				t.Errorf("SendNow() error has Kind %d and StatusCode %d, want ErrorKindResponse and 200", e.Kind, e.StatusCode)
+			}
+		})
+	}
+}
+
+func TestSOCKS5hProxyUsesSOCKSHandshake(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	firstByte := make(chan byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err == nil {
+			firstByte <- b[0]
+		}
+	}()
+
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Minute,
+		HeartbeatURL:      "http://example.com/ping?token=secret",
+		SOCKS5ProxyURL:    "socks5h://" + ln.Addr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = hb.SendNowTimeout(2 * time.Second) }()
+
+	select {
+	case b := <-firstByte:
+		// A SOCKS5 greeting starts with the protocol version; an HTTP proxy request would start with "GET".
+		if b != 0x05 {
+			t.Errorf("first byte sent to the proxy = %q; want the SOCKS5 version 0x05", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a connection to the proxy")
+	}
+}
+
+func TestSendIntervalsRecordedPerURL(t *testing.T) {
+	fast, _ := newRecordingServer(t)
+	slow, _ := newRecordingServer(t)
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval:   100 * time.Millisecond,
+		LivenessThreshold:   time.Hour,
+		HTTPTimeout:         50 * time.Millisecond,
+		HeartbeatURL:        fast.URL,
+		Targets:             []HeartbeatTarget{{URL: slow.URL, Interval: 300 * time.Millisecond}},
+		RecordSendIntervals: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb.Alive(time.Now())
+	if err := hb.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	_ = hb.Stop()
+
+	intervals := hb.Stats().SendIntervals
+	for _, tt := range []struct {
+		url      string
+		interval time.Duration
+	}{
+		{fast.URL, 100 * time.Millisecond},
+		{slow.URL, 300 * time.Millisecond},
+	} {
+		got, ok := intervals[tt.url]
+		if !ok || got.Count == 0 {
+			t.Errorf("no send intervals recorded for the target with a %s interval", tt.interval)
+			continue
+		}
+		if got.Min < tt.interval*3/4 || got.Max > tt.interval*2 {
+			t.Errorf("send intervals for the target with a %s interval ranged from %s to %s", tt.interval, got.Min, got.Max)
+		}
+	}
+}
+
+func TestLastSuccessOnlyForUpSignals(t *testing.T) {
+	srv, received := newRecordingServer(t)
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 100 * time.Millisecond,
+		LivenessThreshold: time.Hour,
+		HTTPTimeout:       50 * time.Millisecond,
+		HeartbeatURL:      srv.URL,
+		SendDownStatus:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed job's signal is delivered, but doesn't indicate that the program is working.
+	_ = hb.RunJob(context.Background(), func() error { return errors.New("boom") })
+	nextRequest(t, received)
+	if got := hb.Stats().LastSuccess; !got.IsZero() {
+		t.Errorf("LastSuccess after a failed job = %s; want the zero time", got)
+	}
+
+	// Neither do down statuses sent while the program isn't alive.
+	if err := hb.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hb.Stop() }()
+	nextRequest(t, received)
+	nextRequest(t, received)
+	if got := hb.Stats().LastSuccess; !got.IsZero() {
+		t.Errorf("LastSuccess after down statuses = %s; want the zero time", got)
+	}
+
+	if err := hb.RunJob(context.Background(), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got := hb.Stats().LastSuccess; got.IsZero() {
+		t.Error("LastSuccess after a successful job is the zero time")
+	}
+}
@@ -0,0 +1,261 @@
+package heartbeat
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// HealthResponseVersion is the version of the HealthResponse format served by the heartbeat HTTP server.
+// Fields may be added to HealthResponse without changing the version; the version will be incremented
+// if a field is removed or its meaning changes.
+const HealthResponseVersion = 1
+
+// HealthResponse is the JSON body served by the heartbeat HTTP server.
+// Its JSON field names are stable and form the server's response contract.
+type HealthResponse struct {
+	// Version is the format version of this response; see HealthResponseVersion.
+	Version int `json:"version"`
+	// OK indicates whether the monitored program is healthy. It is always present.
+	OK bool `json:"ok"`
+	// Error describes why the request was rejected or failed, for 405 Method Not Allowed,
+	// 401 Unauthorized, and 500 Internal Server Error responses. It is omitted otherwise.
+	Error string `json:"error,omitempty"`
+	// Build describes the running build, per Config.BuildInfo. It is omitted if BuildInfo is unset
+	// and from rejected requests' responses.
+	Build *BuildInfo `json:"build,omitempty"`
+	// Reason describes why the program is unhealthy, for responses with Config.UnhealthyStatusCode:
+	// for example, that there's been no recent activity, or which required checks failed.
+	// It is omitted otherwise.
+	Reason string `json:"reason,omitempty"`
+	// Checks reports the result of each of Config.Checks, if Config.VerboseHealth is set.
+	// It is omitted otherwise.
+	Checks []CheckStatus `json:"checks,omitempty"`
+}
+
+// BuildInfo identifies a build of the monitored program, for inclusion in health responses.
+type BuildInfo struct {
+	// Version is the program's version. Optional.
+	Version string `json:"version,omitempty"`
+	// Commit is the VCS commit the program was built from. Optional.
+	Commit string `json:"commit,omitempty"`
+	// BuildTime is when the program was built, in any format. Optional.
+	BuildTime string `json:"build_time,omitempty"`
+}
+
+// pushDegradedUnlocked reports whether any target has failed at least
+// PushFailureThreshold consecutive times.
+func (h *heartbeat) pushDegradedUnlocked() bool {
+	if h.pushFailureThreshold == 0 {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, t := range h.trackedTargetsLocked() {
+		if t.consecutiveFailures >= h.pushFailureThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// startHttpServerLocked binds the heartbeat HTTP server's listeners and starts serving on them.
+// If a listener can't be bound and ServerRetries is zero, it closes any listeners already bound
+// and returns an *Error; otherwise binding is retried in the background.
+func (h *heartbeat) startHttpServerLocked() error {
+	if len(h.serverPorts) == 0 {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeHealthResponse(w, http.StatusMethodNotAllowed, HealthResponse{OK: false, Error: "method not allowed"})
+			return
+		}
+		if h.healthAuthToken != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(h.healthAuthHeader)), []byte(h.healthAuthToken)) != 1 {
+			writeHealthResponse(w, http.StatusUnauthorized, HealthResponse{OK: false, Error: "unauthorized"})
+			return
+		}
+
+		resp := HealthResponse{Build: h.buildInfo}
+		var checkErrs []error
+		if h.verboseHealth {
+			checkErrs = h.runChecks(r.Context())
+			resp.Checks = h.checkStatuses(checkErrs)
+		}
+		switch {
+		case h.stopping():
+			resp.Reason = "stopping"
+		case h.disableTimestampLiveness:
+			resp.Reason = h.forcedDownMessageUnlocked()
+		case !h.observeLivenessUnlocked():
+			resp.Reason = h.downMessageUnlocked()
+		case h.pushDegradedUnlocked():
+			resp.Reason = "heartbeats failing"
+		}
+		if resp.Reason == "" {
+			if !h.verboseHealth {
+				checkErrs = h.runChecks(r.Context())
+			}
+			resp.Reason = h.failedChecksReason(checkErrs)
+		}
+
+		resp.OK = resp.Reason == ""
+		if resp.OK {
+			writeHealthResponse(w, h.healthyStatusCode, resp)
+		} else {
+			writeHealthResponse(w, h.unhealthyStatusCode, resp)
+		}
+	})
+
+	addrs := make([]string, len(h.serverPorts))
+	lns := make([]net.Listener, len(h.serverPorts))
+	for i, port := range h.serverPorts {
+		addrs[i] = fmt.Sprintf(":%d", port)
+		ln, err := h.listen(addrs[i])
+		if err != nil && h.serverRetries == 0 {
+			for _, ln := range lns[:i] {
+				_ = ln.Close()
+			}
+			return &Error{Kind: ErrorKindServer, Err: err}
+		}
+		lns[i] = ln
+	}
+
+	var handler http.Handler = mux
+	for i := len(h.serverMiddleware) - 1; i >= 0; i-- {
+		handler = h.serverMiddleware[i](handler)
+	}
+	h.server = &http.Server{Handler: h.recoverPanics(handler), BaseContext: h.serverBaseContext}
+	for i, ln := range lns {
+		if ln != nil {
+			h.boundAddrs = append(h.boundAddrs, ln.Addr())
+		}
+		h.serveLocked(addrs[i], ln)
+	}
+	return nil
+}
+
+// serveLocked starts serving h.server on the given listener, or if it's nil, on a new listener
+// bound to the given address. If binding or serving fails, it's retried per ServerRetries.
+func (h *heartbeat) serveLocked(addr string, ln net.Listener) {
+	h.wg.Add(1)
+	go func(srv *http.Server) {
+		defer h.wg.Done()
+		backoff := serverRetryBackoff
+		for attempt := 0; ; attempt++ {
+			var err error
+			if ln == nil {
+				if ln, err = h.listen(addr); err == nil {
+					h.addBoundAddr(ln.Addr())
+				}
+			}
+			if err == nil {
+				if h.onServerReady != nil {
+					h.onServerReady(ln.Addr())
+				}
+				err = srv.Serve(ln)
+				h.removeBoundAddr(ln.Addr())
+				ln = nil
+			}
+			if err == nil || errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			if attempt >= h.serverRetries {
+				err = &Error{Kind: ErrorKindServer, Err: err}
+				h.mu.Lock()
+				h.serverErr = errors.Join(h.serverErr, err)
+				h.mu.Unlock()
+				h.reportError(err)
+				return
+			}
+
+			select {
+			case <-h.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, serverRetryMaxBackoff)
+		}
+	}(h.server)
+}
+
+// listen binds a listener to the given address, applying the configured TCP keep-alive period
+// to accepted connections.
+func (h *heartbeat) listen(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: h.serverKeepAlive}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// BoundAddrs returns the addresses the heartbeat HTTP server is currently listening on.
+// Once Start returns nil, it includes every configured port, unless ServerRetries is set
+// and a port couldn't be bound yet.
+func (h *heartbeat) BoundAddrs() []net.Addr {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]net.Addr(nil), h.boundAddrs...)
+}
+
+func (h *heartbeat) addBoundAddr(addr net.Addr) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.boundAddrs = append(h.boundAddrs, addr)
+}
+
+func (h *heartbeat) removeBoundAddr(addr net.Addr) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, a := range h.boundAddrs {
+		if a == addr {
+			h.boundAddrs = append(h.boundAddrs[:i], h.boundAddrs[i+1:]...)
+			return
+		}
+	}
+}
+
+// recoverPanics wraps next so that a panic while handling a request is reported via OnError
+// (and logged, if Logger is set) and answered with a 500 Internal Server Error response,
+// rather than silently dropping the connection.
+func (h *heartbeat) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			err := &Error{Kind: ErrorKindServer, Err: fmt.Errorf("heartbeat server handler panicked: %v", p)}
+			if h.logger != nil {
+				h.logger.Error("heartbeat server handler panicked", "panic", p, "stack", string(debug.Stack()))
+			}
+			h.reportError(err)
+			writeHealthResponse(w, http.StatusInternalServerError, HealthResponse{OK: false, Error: "internal error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeHealthResponse(w http.ResponseWriter, status int, resp HealthResponse) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	resp.Version = HealthResponseVersion
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,65 @@
+package heartbeat
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerRetriesExhaustedDoesNotStopHeartbeats(t *testing.T) {
+	// Hold the heartbeat server's port so it can never be bound.
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	srv, received := newRecordingServer(t)
+	serverErrs := make(chan error, 10)
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: 100 * time.Millisecond,
+		LivenessThreshold: time.Hour,
+		HTTPTimeout:       50 * time.Millisecond,
+		HeartbeatURL:      srv.URL,
+		Port:              port,
+		ServerRetries:     1,
+		OnError: func(err error) {
+			var hbErr *Error
+			if errors.As(err, &hbErr) && hbErr.Kind == ErrorKindServer {
+				serverErrs <- err
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb.Alive(time.Now())
+	if err := hb.Start(); err != nil {
+		t.Fatalf("Start with ServerRetries set returned %v; want nil", err)
+	}
+	defer func() { _ = hb.Stop() }()
+
+	// Heartbeats are sent while the server is still retrying.
+	nextRequest(t, received)
+	if err := hb.ServerErr(); err != nil {
+		t.Errorf("ServerErr before retries were exhausted = %v; want nil", err)
+	}
+
+	select {
+	case <-serverErrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the server failure to be reported")
+	}
+	if err := hb.ServerErr(); err == nil {
+		t.Error("ServerErr after retries were exhausted = nil; want an error")
+	}
+
+	// Heartbeats continue after the server has given up.
+	for len(received) > 0 {
+		<-received
+	}
+	nextRequest(t, received)
+	nextRequest(t, received)
+}
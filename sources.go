@@ -0,0 +1,57 @@
+package heartbeat
+
+import "time"
+
+// LivenessMode selects how the activity of named Sources determines liveness.
+type LivenessMode int
+
+const (
+	// LivenessAllOf requires every source to have been alive within LivenessThreshold. This is the default.
+	LivenessAllOf LivenessMode = iota
+	// LivenessAnyOf requires at least one source to have been alive within LivenessThreshold.
+	LivenessAnyOf
+)
+
+// AliveSource indicates that the named source (one of Config.Sources) was alive and functioning at
+// the given time. It also counts as a call to Alive for Stats. Like Alive, it does not take a lock,
+// coalesces frequent calls, applies MaxAliveSkew, and has no effect after Stop. Calls naming a source
+// not listed in Config.Sources have no effect (and log a warning, if Logger is set).
+func (h *heartbeat) AliveSource(name string, at time.Time) {
+	last, ok := h.sources[name]
+	if !ok {
+		if h.logger != nil {
+			h.logger.Warn("ignoring AliveSource call for unknown source", "source", name)
+		}
+		return
+	}
+	if at.IsZero() || h.ignoreAfterStop("AliveSource") {
+		return
+	}
+
+	at = h.clampAliveSkew(at)
+	h.recordAlive(last, at)
+	h.recordAlive(&h.lastAlive, at)
+	h.observeRecovery()
+}
+
+// sourcesAlive reports whether the Sources' activity indicates liveness, per LivenessMode.
+func (h *heartbeat) sourcesAlive() bool {
+	stale := len(h.staleSources())
+	if h.livenessMode == LivenessAnyOf {
+		return stale < len(h.sourceNames)
+	}
+	return stale == 0
+}
+
+// staleSources returns the names of the Sources which haven't been alive within LivenessThreshold,
+// in the order they're listed in Config.Sources.
+func (h *heartbeat) staleSources() []string {
+	var stale []string
+	for _, name := range h.sourceNames {
+		last := h.sources[name].Load()
+		if last == 0 || time.Since(time.Unix(0, last)) >= h.livenessThreshold {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
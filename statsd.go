@@ -0,0 +1,66 @@
+package heartbeat
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const defaultStatsDMetric = "heartbeat.alive"
+
+// startStatsDLocked starts sending a liveness gauge to StatsDAddr every HeartbeatInterval,
+// as configured (SetInterval doesn't change it).
+func (h *heartbeat) startStatsDLocked() {
+	if h.statsDAddr == "" {
+		return
+	}
+
+	ticker := time.NewTicker(h.statsDInterval)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer ticker.Stop()
+		var conn net.Conn
+		defer func() {
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}()
+
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+			}
+
+			var err error
+			if conn == nil {
+				conn, err = net.DialTimeout("udp", h.statsDAddr, h.client.Load().Timeout)
+			}
+			if err == nil {
+				err = h.sendStatsD(conn, h.observeLivenessUnlocked())
+			}
+			if err != nil {
+				if conn != nil {
+					_ = conn.Close()
+					conn = nil
+				}
+				h.reportError(&Error{Kind: ErrorKindRequest, URL: "udp://" + h.statsDAddr, Err: err})
+			}
+		}
+	}()
+}
+
+// sendStatsD writes the liveness gauge to the given StatsD connection: 1 if alive, 0 otherwise.
+func (h *heartbeat) sendStatsD(conn net.Conn, alive bool) error {
+	value := 0
+	if alive {
+		value = 1
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(h.client.Load().Timeout)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(conn, "%s:%d|g", h.statsDMetric, value)
+	return err
+}
@@ -0,0 +1,157 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Transport selects how heartbeats are sent.
+type Transport int
+
+const (
+	// TransportHTTP sends each heartbeat as an HTTP GET request. This is the default.
+	TransportHTTP Transport = iota
+	// TransportWebSocket sends each heartbeat as a JSON message over a persistent WebSocket
+	// connection to each heartbeat URL, which must use the ws or wss scheme. Messages have the form
+	// {"status":"up"}, or {"status":"down","msg":"..."} when SendDownStatus is set; RunJob also sends
+	// {"status":"start"} when a job starts.
+	// The connection is read continuously, so that pings are answered and a closed or failed
+	// connection is noticed promptly. It's re-established at the next interval after any failure.
+	TransportWebSocket
+)
+
+// validateURL returns an error if rawURL can't be used to send heartbeats with the transport:
+// it must be an absolute http or https URL for TransportHTTP, or ws or wss URL for TransportWebSocket.
+func (t Transport) validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// Unwrap the *url.Error, whose message includes the URL and any credentials in it.
+		return errors.Unwrap(err)
+	}
+	schemes := []string{"http", "https"}
+	if t == TransportWebSocket {
+		schemes = []string{"ws", "wss"}
+	}
+	if u.Scheme != schemes[0] && u.Scheme != schemes[1] {
+		return fmt.Errorf("scheme must be %s or %s", schemes[0], schemes[1])
+	}
+	if u.Host == "" {
+		return errors.New("host must be set")
+	}
+	return nil
+}
+
+type webSocketMessage struct {
+	Status string `json:"status"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// sendWebSocket sends a heartbeat message to the given target over its WebSocket connection,
+// dialing a new connection if needed.
+// A job start signal (see RunJob) is sent as {"status":"start"}, and a job's completion as an up status.
+func (h *heartbeat) sendWebSocket(ctx context.Context, t *target, sig signal) *Error {
+	msg := webSocketMessage{Status: "up", Msg: h.signalMessageUnlocked(sig)}
+	switch sig.kind {
+	case signalDown:
+		msg.Status = "down"
+	case signalStart:
+		msg.Status = "start"
+	}
+
+	t.wsMu.Lock()
+	defer t.wsMu.Unlock()
+
+	if t.wsConn == nil {
+		conn, err := h.dialWebSocket(ctx, t.url)
+		if err != nil {
+			return &Error{Kind: requestErrorKind(err), Err: err}
+		}
+		t.wsConn = conn
+		go h.readWebSocket(t, conn)
+	}
+
+	deadline := time.Now().Add(h.client.Load().Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	err := t.wsConn.SetWriteDeadline(deadline)
+	if err == nil {
+		err = websocket.JSON.Send(t.wsConn, msg)
+	}
+	if err != nil {
+		_ = t.wsConn.Close()
+		t.wsConn = nil
+		return &Error{Kind: requestErrorKind(err), Err: err}
+	}
+	return nil
+}
+
+func (h *heartbeat) dialWebSocket(ctx context.Context, wsURL string) (*websocket.Conn, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	origin := *u
+	origin.Scheme = "http"
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+
+	wsCfg, err := websocket.NewConfig(wsURL, origin.String())
+	if err != nil {
+		return nil, err
+	}
+	wsCfg.Dialer = &net.Dialer{Timeout: h.client.Load().Timeout}
+	if h.tlsConfig != nil {
+		wsCfg.TlsConfig = h.tlsConfig.Clone()
+	}
+
+	conn, err := wsCfg.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return conn, nil
+}
+
+// readWebSocket reads the given target's WebSocket connection, discarding any messages, until the
+// peer closes it or it fails. Reading answers pings, and lets a dead connection be noticed before
+// the next heartbeat is written to it (and, having been buffered, wrongly reported as a success).
+// The connection is then closed, so the next heartbeat dials a new one.
+func (h *heartbeat) readWebSocket(t *target, conn *websocket.Conn) {
+	var msg []byte
+	for websocket.Message.Receive(conn, &msg) == nil {
+	}
+
+	t.wsMu.Lock()
+	defer t.wsMu.Unlock()
+
+	if t.wsConn == conn {
+		_ = conn.Close()
+		t.wsConn = nil
+	}
+}
+
+// closeWebSockets closes the WebSocket connections to all targets, including any opened by
+// SendNow or RunJob without the targets' senders having been started.
+func (h *heartbeat) closeWebSockets() {
+	for _, t := range h.targets {
+		h.closeWebSocket(t)
+	}
+}
+
+// closeWebSocket closes the given target's WebSocket connection, if any.
+func (h *heartbeat) closeWebSocket(t *target) {
+	t.wsMu.Lock()
+	defer t.wsMu.Unlock()
+
+	if t.wsConn != nil {
+		_ = t.wsConn.Close()
+		t.wsConn = nil
+	}
+}
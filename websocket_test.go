@@ -0,0 +1,131 @@
+package heartbeat
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// newWebSocketServer returns a WebSocket server which reads messages until its client closes the
+// connection, and a channel which is closed when that happens.
+func newWebSocketServer(t *testing.T) (*httptest.Server, <-chan struct{}) {
+	t.Helper()
+	closed := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer close(closed)
+		var msg webSocketMessage
+		for websocket.JSON.Receive(ws, &msg) == nil {
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, closed
+}
+
+// webSocketURL returns the ws URL of the given server.
+func webSocketURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestVerifyOnInitFailureClosesWebSockets(t *testing.T) {
+	srv, closed := newWebSocketServer(t)
+	unreachable, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachableURL := "ws://" + unreachable.Addr().String() + "/"
+	unreachable.Close()
+
+	_, err = NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Minute,
+		Transport:         TransportWebSocket,
+		Targets:           []HeartbeatTarget{{URL: webSocketURL(srv)}, {URL: unreachableURL}},
+		VerifyOnInit:      true,
+	})
+	if err == nil {
+		t.Fatal("NewHeartbeat succeeded; want a verification error")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the successful target's WebSocket connection was left open")
+	}
+}
+
+func TestWebSocketClosedByPeerIsRedialed(t *testing.T) {
+	conns := make(chan struct{}, 10)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns <- struct{}{}
+		// Close the connection after the first heartbeat.
+		var msg webSocketMessage
+		_ = websocket.JSON.Receive(ws, &msg)
+	}))
+	defer srv.Close()
+
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Minute,
+		Transport:         TransportWebSocket,
+		HeartbeatURL:      webSocketURL(srv),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hb.Stop() }()
+	if err := hb.SendNowTimeout(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The closed connection is noticed without writing to it.
+	tgt := hb.(*heartbeat).targets[0]
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tgt.wsMu.Lock()
+		open := tgt.wsConn != nil
+		tgt.wsMu.Unlock()
+		if !open {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection closed by the peer wasn't noticed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := hb.SendNowTimeout(5 * time.Second); err != nil {
+		t.Fatalf("SendNow after the peer closed the connection = %v; want nil", err)
+	}
+	if n := len(conns); n != 2 {
+		t.Errorf("server received %d connections; want 2", n)
+	}
+}
+
+func TestStopClosesWebSocketsWithoutStart(t *testing.T) {
+	srv, closed := newWebSocketServer(t)
+	hb, err := NewHeartbeat(&Config{
+		HeartbeatInterval: time.Minute,
+		LivenessThreshold: time.Minute,
+		Transport:         TransportWebSocket,
+		HeartbeatURL:      webSocketURL(srv),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hb.SendNowTimeout(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := hb.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop left the WebSocket connection open")
+	}
+}